@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// rrsigType is RRSIG's wire type (RFC 4034); golang.org/x/net/dns/dnsmessage
+// has no constant for it since it never parses RRSIG bodies, but resource
+// headers for unsupported types are still reported.
+const rrsigType = 46
+
+var rcodeNames = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+func rcodeName(rcode dnsmessage.RCode) string {
+	if name, ok := rcodeNames[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// classifyResponse fills in the classification fields of a QueryResult
+// from a parsed DNS response: RCODE, the TC/AA bits, section counts,
+// whether the requested type actually came back in the answer, and (when
+// -dnssec was requested) whether an RRSIG was present to validate against.
+func classifyResponse(result *QueryResult, response *dnsmessage.Message, recordType uint16, opts QueryOptions) {
+	result.RCode = rcodeName(response.Header.RCode)
+	result.Truncated = response.Header.Truncated
+	result.Authoritative = response.Header.Authoritative
+	result.AnswerCount = len(response.Answers)
+	result.AuthorityCount = len(response.Authorities)
+	result.AdditionalCount = len(response.Additionals)
+
+	for _, rr := range response.Answers {
+		if uint16(rr.Header.Type) == recordType {
+			result.AnswerTypeMatched = true
+		}
+		if opts.DNSSEC && uint16(rr.Header.Type) == rrsigType {
+			result.DNSSECValidated = true
+		}
+	}
+
+	if opts.NSID {
+		result.NSID = nsidFromAdditionals(response.Additionals)
+	}
+
+	if opts.Cookie {
+		result.CookieEchoed = serverCookieFromAdditionals(response.Additionals)
+	}
+}
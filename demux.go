@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// rawConn is implemented by transports whose underlying socket can only
+// safely be used by one goroutine at a time for send and one for receive
+// (udp and the stream-based tcp/tls transports). demuxConn multiplexes
+// concurrent callers of Query over such a connection.
+type rawConn interface {
+	send(msg []byte) error
+	recv() ([]byte, error)
+	Close() error
+}
+
+// demuxConn lets many workers share a single rawConn by matching each
+// response back to its caller via the 2-byte DNS transaction ID at the
+// start of every DNS message. A single goroutine owns the reads; sends
+// may happen concurrently.
+type demuxConn struct {
+	raw rawConn
+
+	mu      sync.Mutex
+	pending map[uint16]chan demuxResult
+	nextID  uint16
+	started bool
+}
+
+type demuxResult struct {
+	data []byte
+	err  error
+}
+
+func newDemuxConn(raw rawConn) *demuxConn {
+	return &demuxConn{raw: raw, pending: make(map[uint16]chan demuxResult)}
+}
+
+func (d *demuxConn) startReader() {
+	d.mu.Lock()
+	if d.started {
+		d.mu.Unlock()
+		return
+	}
+	d.started = true
+	d.mu.Unlock()
+
+	go func() {
+		for {
+			resp, err := d.raw.recv()
+			if err != nil {
+				// recv() is bounded by a read deadline (see
+				// demuxReadTimeout) purely so this loop wakes up
+				// periodically; it doesn't mean the connection died; keep
+				// waiting for whatever's still pending.
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					continue
+				}
+				d.broadcastError(err)
+				return
+			}
+			if len(resp) < 2 {
+				continue
+			}
+			id := binary.BigEndian.Uint16(resp[:2])
+			d.mu.Lock()
+			ch, ok := d.pending[id]
+			if ok {
+				delete(d.pending, id)
+			}
+			d.mu.Unlock()
+			if ok {
+				ch <- demuxResult{data: resp}
+			}
+		}
+	}()
+}
+
+func (d *demuxConn) broadcastError(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, ch := range d.pending {
+		ch <- demuxResult{err: err}
+		delete(d.pending, id)
+	}
+}
+
+func (d *demuxConn) Query(ctx context.Context, msg []byte) ([]byte, error) {
+	if len(msg) < 2 {
+		return nil, fmt.Errorf("dns message too short to demux")
+	}
+
+	// The caller picked a random transaction ID, but random IDs collide
+	// often enough under real concurrency to orphan callers (see
+	// allocateIDLocked); assign one that's guaranteed unique among
+	// in-flight queries on this connection and overwrite it in the
+	// message, since the server echoes the ID back unchanged.
+	ch := make(chan demuxResult, 1)
+	d.mu.Lock()
+	id := d.allocateIDLocked()
+	d.pending[id] = ch
+	d.mu.Unlock()
+	binary.BigEndian.PutUint16(msg[:2], id)
+	d.startReader()
+
+	if err := d.raw.send(msg); err != nil {
+		d.mu.Lock()
+		delete(d.pending, id)
+		d.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case r := <-ch:
+		return r.data, r.err
+	case <-ctx.Done():
+		d.mu.Lock()
+		delete(d.pending, id)
+		d.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// allocateIDLocked returns a transaction ID with no query currently
+// pending under it. d.mu must be held.
+func (d *demuxConn) allocateIDLocked() uint16 {
+	for {
+		id := d.nextID
+		d.nextID++
+		if _, taken := d.pending[id]; !taken {
+			return id
+		}
+	}
+}
+
+func (d *demuxConn) Close() error { return d.raw.Close() }
+
+// dialShared dials a single connection to be shared by every worker. If
+// the transport's connection isn't safe for concurrent use on its own
+// (udp and tcp/tls, which read and write a single socket), it's wrapped
+// in a demuxConn so concurrent callers don't see each other's responses.
+func dialShared(ctx context.Context, transport Transport) (Conn, time.Duration, error) {
+	conn, handshake, err := transport.Dial(ctx)
+	if err != nil {
+		return nil, handshake, err
+	}
+	if raw, ok := conn.(rawConn); ok {
+		return newDemuxConn(raw), handshake, nil
+	}
+	// https and quic conns already support concurrent Query calls
+	// (one HTTP request / QUIC stream per call), so no demuxer needed.
+	return conn, handshake, nil
+}
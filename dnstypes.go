@@ -0,0 +1,27 @@
+package main
+
+import "fmt"
+
+// recordTypeMap maps the record type names accepted by -type (and by
+// query plan files) to their DNS wire values.
+var recordTypeMap = map[string]uint16{
+	"A":     1,
+	"NS":    2,
+	"CNAME": 5,
+	"SOA":   6,
+	"PTR":   12,
+	"MX":    15,
+	"TXT":   16,
+	"AAAA":  28,
+}
+
+// recordTypeName returns the name for a DNS wire type value, or "TYPEn"
+// if it isn't one recordTypeMap knows about.
+func recordTypeName(t uint16) string {
+	for name, val := range recordTypeMap {
+		if val == t {
+			return name
+		}
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/rand"
+	"net"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// EDNS0 option codes used by this tool.
+const (
+	nsidOptionCode   = 3  // RFC 5001
+	subnetOptionCode = 8  // RFC 7871
+	cookieOptionCode = 10 // RFC 7873
+)
+
+// ednsDOBit is the DNSSEC OK bit (RFC 3225), encoded in the OPT record's
+// extended RCODE/flags field (carried in the TTL slot of the RR).
+const ednsDOBit uint32 = 1 << 15
+
+// clientCookieSize is the fixed size of the client half of an EDNS cookie
+// (RFC 7873); the server cookie that follows it is 8-32 bytes.
+const clientCookieSize = 8
+
+// defaultUDPPayloadSize is the -bufsize default and the OPT record class
+// used when -bufsize isn't set.
+const defaultUDPPayloadSize = 4096
+
+// QueryOptions controls the EDNS0 options (and related query behaviour)
+// attached to every outgoing query.
+type QueryOptions struct {
+	DNSSEC bool // set the DO bit and expect RRSIGs in the answer
+	NSID   bool // request the responding server's NSID
+
+	BufSize int        // advertised UDP payload size (OPT record class)
+	Subnet  *net.IPNet // EDNS Client Subnet to attach, or nil
+	Cookie  bool       // send a client cookie and check for a server cookie
+}
+
+// clientCookie is generated once per process and reused for every query,
+// per RFC 7873's recommendation that it stay stable for a client/server
+// pair.
+var clientCookie = func() [clientCookieSize]byte {
+	var c [clientCookieSize]byte
+	rand.Read(c[:])
+	return c
+}()
+
+// buildOPT constructs the EDNS0 OPT pseudo-RR for these options. An OPT
+// record is always returned since -bufsize applies to every query.
+func buildOPT(opts QueryOptions) (rr dnsmessage.Resource, ok bool) {
+	bufSize := opts.BufSize
+	if bufSize == 0 {
+		bufSize = defaultUDPPayloadSize
+	}
+
+	var options []dnsmessage.Option
+	if opts.NSID {
+		options = append(options, dnsmessage.Option{Code: nsidOptionCode})
+	}
+	if opts.Subnet != nil {
+		options = append(options, dnsmessage.Option{Code: subnetOptionCode, Data: encodeSubnet(opts.Subnet)})
+	}
+	if opts.Cookie {
+		options = append(options, dnsmessage.Option{Code: cookieOptionCode, Data: clientCookie[:]})
+	}
+
+	var ttl uint32
+	if opts.DNSSEC {
+		ttl = ednsDOBit
+	}
+
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  dnsmessage.MustNewName("."),
+			Class: dnsmessage.Class(bufSize),
+			TTL:   ttl,
+		},
+		Body: &dnsmessage.OPTResource{Options: options},
+	}, true
+}
+
+// encodeSubnet packs a CIDR as an EDNS Client Subnet option (RFC 7871):
+// family (1 = IPv4, 2 = IPv6), source prefix length, scope prefix length
+// (0 in a query), then the address truncated to the prefix length and
+// rounded up to a whole byte.
+func encodeSubnet(subnet *net.IPNet) []byte {
+	family := uint16(1)
+	ip := subnet.IP.To4()
+	if ip == nil {
+		family = 2
+		ip = subnet.IP.To16()
+	}
+	prefixLen, _ := subnet.Mask.Size()
+	addrBytes := (prefixLen + 7) / 8
+
+	data := make([]byte, 4+addrBytes)
+	data[0] = byte(family >> 8)
+	data[1] = byte(family)
+	data[2] = byte(prefixLen)
+	data[3] = 0 // scope prefix length, unset in a query
+	copy(data[4:], ip[:addrBytes])
+	return data
+}
+
+// nsidFromAdditionals returns the NSID string from the OPT record in the
+// additional section, if present.
+func nsidFromAdditionals(additionals []dnsmessage.Resource) string {
+	opt := findOPT(additionals, nsidOptionCode)
+	if opt == nil {
+		return ""
+	}
+	return string(opt)
+}
+
+// serverCookieFromAdditionals reports whether the OPT record in the
+// additional section echoed back a server cookie (anything past the
+// 8-byte client cookie we sent).
+func serverCookieFromAdditionals(additionals []dnsmessage.Resource) bool {
+	opt := findOPT(additionals, cookieOptionCode)
+	return len(opt) > clientCookieSize
+}
+
+// findOPT returns the data of the first EDNS0 option with the given code
+// in the additional section's OPT record, or nil if absent.
+func findOPT(additionals []dnsmessage.Resource, code uint16) []byte {
+	for _, rr := range additionals {
+		opt, ok := rr.Body.(*dnsmessage.OPTResource)
+		if !ok {
+			continue
+		}
+		for _, o := range opt.Options {
+			if o.Code == code {
+				return o.Data
+			}
+		}
+	}
+	return nil
+}
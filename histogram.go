@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// latencyMinMicros and latencyMaxMicros bound the log-linear buckets used
+// to track query latency, from 1µs to 60s.
+const (
+	latencyMinMicros = 1
+	latencyMaxMicros = 60 * 1000 * 1000
+	latencySigFigs   = 3
+)
+
+// percentiles are reported in this order.
+var percentiles = []struct {
+	label string
+	q     float64
+}{
+	{"p50", 50},
+	{"p90", 90},
+	{"p95", 95},
+	{"p99", 99},
+	{"p99.9", 99.9},
+}
+
+// LatencyRecorder tracks the full distribution of query latencies so the
+// summary can report percentiles and tail behaviour rather than just a
+// mean.
+type LatencyRecorder struct {
+	mu   sync.Mutex
+	hist *hdrhistogram.Histogram
+}
+
+func NewLatencyRecorder() *LatencyRecorder {
+	return &LatencyRecorder{
+		hist: hdrhistogram.New(latencyMinMicros, latencyMaxMicros, latencySigFigs),
+	}
+}
+
+func (r *LatencyRecorder) Record(d time.Duration) {
+	us := d.Microseconds()
+	if us < latencyMinMicros {
+		us = latencyMinMicros
+	}
+	if us > latencyMaxMicros {
+		us = latencyMaxMicros
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hist.RecordValue(us)
+}
+
+// Percentiles returns p50/p90/p95/p99/p99.9 and the max, in that order.
+func (r *LatencyRecorder) Percentiles() []struct {
+	Label string
+	Value time.Duration
+} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]struct {
+		Label string
+		Value time.Duration
+	}, 0, len(percentiles)+1)
+	for _, p := range percentiles {
+		out = append(out, struct {
+			Label string
+			Value time.Duration
+		}{p.label, time.Duration(r.hist.ValueAtQuantile(p.q)) * time.Microsecond})
+	}
+	out = append(out, struct {
+		Label string
+		Value time.Duration
+	}{"max", time.Duration(r.hist.Max()) * time.Microsecond})
+	return out
+}
+
+// Buckets returns the non-empty log-linear buckets, for -output json.
+func (r *LatencyRecorder) Buckets() []HistogramBucket {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var buckets []HistogramBucket
+	for _, bar := range r.hist.Distribution() {
+		if bar.Count == 0 {
+			continue
+		}
+		buckets = append(buckets, HistogramBucket{
+			FromMicros: bar.From,
+			ToMicros:   bar.To,
+			Count:      bar.Count,
+		})
+	}
+	return buckets
+}
+
+// HistogramBucket is one log-linear latency bucket, in microseconds.
+type HistogramBucket struct {
+	FromMicros int64 `json:"from_micros"`
+	ToMicros   int64 `json:"to_micros"`
+	Count      int64 `json:"count"`
+}
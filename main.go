@@ -2,110 +2,69 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
 	"flag"
 	"fmt"
 	"log"
-	"math/rand"
 	"net"
 	"os"
 	"os/signal"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
-
-	"golang.org/x/net/dns/dnsmessage"
 )
 
-type QueryResult struct {
-	Duration time.Duration
-	Success  bool
-}
-
-func performDNSQuery(dnsServer, domain string, recordType uint16) QueryResult {
-	start := time.Now()
-
-	conn, err := net.Dial("udp", dnsServer)
-	if err != nil {
-		log.Printf("Error connecting to DNS server: %v", err)
-		return QueryResult{time.Since(start), false}
-	}
-	defer conn.Close()
-
-	m := new(dnsmessage.Message)
-	m.Header.ID = uint16(rand.Intn(65535))
-	m.Header.RecursionDesired = true
-	m.Questions = []dnsmessage.Question{
-		{
-			Name:  dnsmessage.MustNewName(domain + "."),
-			Type:  dnsmessage.Type(recordType),
-			Class: dnsmessage.ClassINET,
-		},
-	}
-
-	packed, err := m.Pack()
-	if err != nil {
-		log.Printf("Error packing DNS message: %v", err)
-		return QueryResult{time.Since(start), false}
-	}
-
-	_, err = conn.Write(packed)
-	if err != nil {
-		log.Printf("Error sending DNS query: %v", err)
-		return QueryResult{time.Since(start), false}
-	}
-
-	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
-
-	resp := make([]byte, 512)
-	_, err = conn.Read(resp)
-	if err != nil {
-		log.Printf("Error reading DNS response: %v", err)
-		return QueryResult{time.Since(start), false}
-	}
-
-	var response dnsmessage.Message
-	err = response.Unpack(resp)
-	if err != nil {
-		log.Printf("Error unpacking DNS response: %v", err)
-		return QueryResult{time.Since(start), false}
-	}
-
-	return QueryResult{time.Since(start), true}
-}
-
-func worker(ctx context.Context, dnsServer, domain string, recordType uint16, jobs <-chan int, results chan<- QueryResult, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case _, ok := <-jobs:
-			if !ok {
-				return
-			}
-			result := performDNSQuery(dnsServer, domain, recordType)
-			results <- result
-		}
-	}
-}
-
 func main() {
-	domain := flag.String("domain", "", "Domain name to query")
+	domain := flag.String("domain", "", "Domain name to query, or a query plan: @file.txt or an http(s):// URL of lines \"NAME [TYPE]\"")
 	recordTypeStr := flag.String("type", "A", "DNS record type (A, AAAA, MX, TXT, NS)")
 	queries := flag.Int("queries", -1, "Number of queries to perform (-1 for continuous)")
 	concurrency := flag.Int("concurrency", 10, "Number of concurrent queries")
 	dnsServer := flag.String("dns", "8.8.8.8", "DNS server to use (IP or IP:port)")
 	logFile := flag.String("log", "", "Log file to write DNS queries (default: write to stdout)")
+	protocol := flag.String("protocol", "udp", "Transport protocol to use (udp, tcp, tls, https, quic)")
+	serverName := flag.String("server-name", "", "Expected TLS server name for -protocol tls|https|quic (defaults to the -dns host)")
+	insecure := flag.Bool("insecure", false, "Skip TLS certificate verification for -protocol tls|https|quic")
+	separateWorkerConnections := flag.Bool("separate-worker-connections", false, "Give each worker its own connection instead of sharing one connection across all workers")
+	probability := flag.Float64("probability", 1.0, "When -domain names a query plan file/URL, keep each line with this probability")
+	randomize := flag.Bool("randomize", false, "Draw a random entry from the query plan for each query instead of cycling through it in order")
+	output := flag.String("output", "text", "Result format: text, json (run summary) or csv (per-query records)")
+	prometheusAddr := flag.String("prometheus", "", "Serve live dnsperf_* Prometheus metrics on this address (e.g. :9090) while the run is in progress")
+	qps := flag.Float64("qps", 0, "Open-loop mode: emit queries at this fixed rate regardless of in-flight count, instead of the default closed-loop (one query per free worker)")
+	maxInflight := flag.Int("max-inflight", 1000, "With -qps, the maximum number of queries that may be queued/in flight at once; scheduled queries beyond this are dropped and counted")
+	dnssec := flag.Bool("dnssec", false, "Set the EDNS0 DO bit and check for an RRSIG in the answer")
+	nsid := flag.Bool("nsid", false, "Request the responding server's NSID (RFC 5001) and log it")
+	bufSize := flag.Int("bufsize", defaultUDPPayloadSize, "EDNS0 UDP payload size to advertise in the OPT record")
+	subnet := flag.String("subnet", "", "Attach this CIDR as an EDNS Client Subnet option (RFC 7871), e.g. 203.0.113.0/24")
+	cookie := flag.Bool("cookie", false, "Send an EDNS0 client cookie (RFC 7873) and check whether the server echoes a server cookie")
 	flag.Parse()
 
+	if *output != "text" && *output != "json" && *output != "csv" {
+		fmt.Printf("Invalid -output %q (want text, json or csv)\n", *output)
+		os.Exit(1)
+	}
+
+	if err := validateQPSFlags(*qps, *maxInflight); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	var subnetCIDR *net.IPNet
+	if *subnet != "" {
+		var err error
+		_, subnetCIDR, err = net.ParseCIDR(*subnet)
+		if err != nil {
+			fmt.Printf("Invalid -subnet %q: %v\n", *subnet, err)
+			os.Exit(1)
+		}
+	}
+
 	if *domain == "" {
 		fmt.Println("Please provide a domain name using the -domain flag")
 		os.Exit(1)
 	}
 
 	if !strings.Contains(*dnsServer, ":") {
-		*dnsServer = *dnsServer + ":53"
+		*dnsServer = *dnsServer + ":" + defaultPort(*protocol)
 	}
 
 	if *logFile != "" {
@@ -117,43 +76,87 @@ func main() {
 		log.SetOutput(f)
 	}
 
-	recordTypeMap := map[string]uint16{
-		"A":     1,
-		"NS":    2,
-		"CNAME": 5,
-		"SOA":   6,
-		"PTR":   12,
-		"MX":    15,
-		"TXT":   16,
-		"AAAA":  28,
-	}
-
 	recordType, ok := recordTypeMap[*recordTypeStr]
 	if !ok {
 		fmt.Printf("Invalid record type: %s\n", *recordTypeStr)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Starting DNS performance test for %s (%s record)\n", *domain, *recordTypeStr)
-	fmt.Printf("Using DNS server: %s\n", *dnsServer)
-	fmt.Printf("Concurrency: %d\n", *concurrency)
+	transport, err := NewTransport(*protocol, TransportConfig{
+		Server:     *dnsServer,
+		ServerName: *serverName,
+		Insecure:   *insecure,
+		BufSize:    *bufSize,
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-	if *queries != -1 {
-		fmt.Printf("Number of queries: %d\n", *queries)
+	var plan []QueryPlanEntry
+	if isQueryPlanSource(*domain) {
+		plan, err = loadQueryPlan(*domain, recordType, *probability)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	} else {
-		fmt.Println("Running continuously. Press Ctrl+C to stop.")
+		plan = []QueryPlanEntry{{Name: *domain, Type: recordType}}
+	}
+
+	// The live progress counter and startup banner are for interactive
+	// use; suppress them for machine-readable output modes.
+	if *output == "text" {
+		if len(plan) > 1 {
+			fmt.Printf("Starting DNS performance test for %d names from %s\n", len(plan), *domain)
+		} else {
+			fmt.Printf("Starting DNS performance test for %s (%s record)\n", *domain, *recordTypeStr)
+		}
+		fmt.Printf("Using DNS server: %s (%s)\n", *dnsServer, transport.Name())
+		fmt.Printf("Concurrency: %d\n", *concurrency)
+
+		if *queries != -1 {
+			fmt.Printf("Number of queries: %d\n", *queries)
+		} else {
+			fmt.Println("Running continuously. Press Ctrl+C to stop.")
+		}
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	jobs := make(chan int)
+	jobQueueSize := 0
+	if *qps > 0 {
+		jobQueueSize = *maxInflight
+	}
+	jobs := make(chan Job, jobQueueSize)
 	results := make(chan QueryResult, *concurrency)
+	stats := NewStats()
+
+	var sharedConn Conn
+	if !*separateWorkerConnections {
+		conn, handshake, err := dialShared(ctx, transport)
+		if err != nil {
+			fmt.Printf("Error dialing %s transport: %v\n", transport.Name(), err)
+			os.Exit(1)
+		}
+		defer conn.Close()
+		sharedConn = conn
+		if *output == "text" {
+			fmt.Printf("Sharing a single connection across %d workers (handshake: %s)\n", *concurrency, handshake)
+		}
+	}
+
+	if *prometheusAddr != "" {
+		servePrometheusMetrics(*prometheusAddr, stats)
+	}
+
+	opts := QueryOptions{DNSSEC: *dnssec, NSID: *nsid, BufSize: *bufSize, Subnet: subnetCIDR, Cookie: *cookie}
 
 	var wg sync.WaitGroup
 	for i := 0; i < *concurrency; i++ {
 		wg.Add(1)
-		go worker(ctx, *dnsServer, *domain, recordType, jobs, results, &wg)
+		go worker(ctx, transport, sharedConn, plan, opts, jobs, results, &wg)
 	}
 
 	go func() {
@@ -162,39 +165,41 @@ func main() {
 	}()
 
 	start := time.Now()
-	var queryCount, successCount int64
+	var queryCount int64
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
 
-	go func() {
-		for *queries == -1 || atomic.LoadInt64(&queryCount) < int64(*queries) {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				jobs <- 1
-				atomic.AddInt64(&queryCount, 1)
-				currentCount := atomic.LoadInt64(&queryCount)
-				if currentCount%10 == 0 || currentCount == int64(*queries) {
-					fmt.Printf("\rCompleted %d queries", currentCount)
-					if *queries != -1 {
-						fmt.Printf(" (%.1f%%)", float64(currentCount)/float64(*queries)*100)
-					}
-				}
+	progress := func(count int64) {
+		if *output == "text" && (count%10 == 0 || count == int64(*queries)) {
+			fmt.Printf("\rCompleted %d queries", count)
+			if *queries != -1 {
+				fmt.Printf(" (%.1f%%)", float64(count)/float64(*queries)*100)
 			}
 		}
-		close(jobs)
-	}()
+	}
+	if *qps > 0 {
+		go runOpenLoopScheduler(ctx, jobs, len(plan), *randomize, int64(*queries), &queryCount, *qps, stats, progress)
+	} else {
+		go runClosedLoopDispatcher(ctx, jobs, len(plan), *randomize, int64(*queries), &queryCount, progress)
+	}
 
-	var totalDuration time.Duration
+	var csvWriter *csv.Writer
+	if *output == "csv" {
+		csvWriter = csv.NewWriter(os.Stdout)
+		writeCSVHeader(csvWriter)
+	}
 
 	done := make(chan struct{})
 	go func() {
 		for result := range results {
-			totalDuration += result.Duration
-			if result.Success {
-				atomic.AddInt64(&successCount, 1)
+			stats.Record(result)
+			if *nsid && result.NSID != "" {
+				log.Printf("NSID from %s: %q", result.Name, result.NSID)
+			}
+			if csvWriter != nil {
+				writeCSVRow(csvWriter, result)
+				csvWriter.Flush()
 			}
 		}
 		close(done)
@@ -202,26 +207,95 @@ func main() {
 
 	select {
 	case <-sigChan:
-		fmt.Println("\nInterrupted by user. Shutting down...")
+		if *output == "text" {
+			fmt.Println("\nInterrupted by user. Shutting down...")
+		}
 		cancel()
 	case <-done:
-		fmt.Println("\nAll queries completed. Shutting down...")
+		if *output == "text" {
+			fmt.Println("\nAll queries completed. Shutting down...")
+		}
 	}
 
 	<-done // Ensure all results are processed
 
-	finalQueryCount := atomic.LoadInt64(&queryCount)
-	finalSuccessCount := atomic.LoadInt64(&successCount)
 	elapsed := time.Since(start)
-	avgDuration := totalDuration / time.Duration(finalQueryCount)
-	qps := float64(finalQueryCount) / elapsed.Seconds()
-	successRate := float64(finalSuccessCount) / float64(finalQueryCount) * 100
-
-	fmt.Printf("\nResults for %s (%s record):\n", *domain, *recordTypeStr)
-	fmt.Printf("Total queries: %d\n", finalQueryCount)
-	fmt.Printf("Successful queries: %d (%.2f%%)\n", finalSuccessCount, successRate)
-	fmt.Printf("Failed queries: %d (%.2f%%)\n", finalQueryCount-finalSuccessCount, 100-successRate)
+
+	switch *output {
+	case "json":
+		if err := printJSONSummary(os.Stdout, buildSummary(*domain, transport.Name(), *concurrency, elapsed, stats)); err != nil {
+			log.Fatalf("error writing json summary: %v", err)
+		}
+	case "csv":
+		csvWriter.Flush()
+	default:
+		printTextSummary(*domain, *recordTypeStr, len(plan), elapsed, stats, *bufSize, *cookie, *dnssec)
+	}
+}
+
+func printTextSummary(domain, recordTypeStr string, planSize int, elapsed time.Duration, stats *Stats, bufSize int, cookie, dnssec bool) {
+	total := stats.Total()
+	success := stats.Success()
+	qps := float64(total) / elapsed.Seconds()
+	successRate := float64(success) / float64(total) * 100
+
+	if planSize > 1 {
+		fmt.Printf("\nResults for %d names from %s:\n", planSize, domain)
+	} else {
+		fmt.Printf("\nResults for %s (%s record):\n", domain, recordTypeStr)
+	}
+	fmt.Printf("Total queries: %d\n", total)
+	fmt.Printf("Successful queries: %d (%.2f%%)\n", success, successRate)
+	fmt.Printf("Failed queries: %d (%.2f%%)\n", total-success, 100-successRate)
 	fmt.Printf("Total time: %.2f seconds\n", elapsed.Seconds())
-	fmt.Printf("Average query time: %.4f seconds\n", avgDuration.Seconds())
 	fmt.Printf("Queries per second: %.2f\n", qps)
-}
\ No newline at end of file
+
+	fmt.Println("Service time distribution (send -> receive):")
+	for _, p := range stats.Latency.Percentiles() {
+		fmt.Printf("  %-6s %.4f seconds\n", p.Label, p.Value.Seconds())
+	}
+
+	if stats.HasResponseLatency() {
+		fmt.Println("Response time distribution (scheduled -> receive):")
+		for _, p := range stats.ResponseLatency.Percentiles() {
+			fmt.Printf("  %-6s %.4f seconds\n", p.Label, p.Value.Seconds())
+		}
+		if dropped := stats.DroppedCount(); dropped > 0 {
+			fmt.Printf("Dropped (max-inflight exceeded): %d\n", dropped)
+		}
+	}
+
+	if avgHandshake, count := stats.Handshakes(); count > 0 {
+		fmt.Printf("Average handshake time (%d connections): %.4f seconds\n", count, avgHandshake.Seconds())
+	}
+
+	fmt.Println("Response code breakdown:")
+	rcodes := stats.RCodeCounts()
+	for _, name := range sortedKeys(rcodes) {
+		fmt.Printf("  %-10s %d (%.2f%%)\n", name, rcodes[name], percentOf(rcodes[name], total))
+	}
+	fmt.Printf("Truncated despite %d-byte advertised buffer: %.2f%%\n", bufSize, percentOf(stats.TruncatedCount(), total))
+	fmt.Printf("Empty-answer NOERROR: %.2f%%\n", percentOf(stats.EmptyNoErrorCount(), total))
+	fmt.Printf("Authoritative: %.2f%%\n", percentOf(stats.AuthoritativeCount(), total))
+	fmt.Printf("Answer type matched request: %.2f%%\n", percentOf(stats.AnswerTypeMatchedCount(), total))
+	fmt.Printf("Mean authority/additional records: %.2f / %.2f\n", stats.MeanAuthorityCount(), stats.MeanAdditionalCount())
+	if dnssec {
+		fmt.Printf("RRSIG present (DNSSEC validated): %.2f%%\n", percentOf(stats.DNSSECValidatedCount(), total))
+	}
+	if cookie {
+		fmt.Printf("Server cookie echoed: %.2f%%\n", percentOf(stats.CookieEchoedCount(), total))
+	}
+}
+
+// defaultPort returns the conventional port for a transport protocol when
+// -dns does not already specify one.
+func defaultPort(protocol string) string {
+	switch protocol {
+	case "tls", "quic":
+		return "853"
+	case "https":
+		return "443"
+	default:
+		return "53"
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Summary is the -output json representation of a completed run.
+type Summary struct {
+	Domain                   string             `json:"domain"`
+	Protocol                 string             `json:"protocol"`
+	Concurrency              int                `json:"concurrency"`
+	Total                    int64              `json:"total_queries"`
+	Success                  int64              `json:"successful_queries"`
+	Failed                   int64              `json:"failed_queries"`
+	Elapsed                  float64            `json:"elapsed_seconds"`
+	QPS                      float64            `json:"queries_per_second"`
+	Percentiles              map[string]float64 `json:"latency_percentiles_seconds"`
+	ResponsePercentiles      map[string]float64 `json:"response_time_percentiles_seconds,omitempty"`
+	Dropped                  int64              `json:"dropped_queries,omitempty"`
+	RCodes                   map[string]int64   `json:"rcode_counts"`
+	Errors                   map[string]int64   `json:"error_reason_counts"`
+	Histogram                []HistogramBucket  `json:"latency_histogram_micros"`
+	TruncatedPercent         float64            `json:"truncated_percent"`
+	EmptyAnswerPercent       float64            `json:"empty_answer_noerror_percent"`
+	AuthoritativePercent     float64            `json:"authoritative_percent"`
+	AnswerTypeMatchedPercent float64            `json:"answer_type_matched_percent"`
+	DNSSECValidatedPercent   float64            `json:"dnssec_validated_percent"`
+	MeanAuthorityCount       float64            `json:"mean_authority_count"`
+	MeanAdditionalCount      float64            `json:"mean_additional_count"`
+}
+
+func buildSummary(domain, protocol string, concurrency int, elapsed time.Duration, stats *Stats) Summary {
+	percentileSeconds := make(map[string]float64)
+	for _, p := range stats.Latency.Percentiles() {
+		percentileSeconds[p.Label] = p.Value.Seconds()
+	}
+	var responsePercentileSeconds map[string]float64
+	if stats.HasResponseLatency() {
+		responsePercentileSeconds = make(map[string]float64)
+		for _, p := range stats.ResponseLatency.Percentiles() {
+			responsePercentileSeconds[p.Label] = p.Value.Seconds()
+		}
+	}
+	total := stats.Total()
+	return Summary{
+		Domain:              domain,
+		Protocol:            protocol,
+		Concurrency:         concurrency,
+		Total:               total,
+		Success:             stats.Success(),
+		Failed:              total - stats.Success(),
+		Elapsed:             elapsed.Seconds(),
+		QPS:                 float64(total) / elapsed.Seconds(),
+		Percentiles:         percentileSeconds,
+		ResponsePercentiles: responsePercentileSeconds,
+		Dropped:             stats.DroppedCount(),
+		RCodes:              stats.RCodeCounts(),
+		Errors:              stats.ErrorReasonCounts(),
+		Histogram:           stats.Latency.Buckets(),
+		TruncatedPercent:    percentOf(stats.TruncatedCount(), total),
+		EmptyAnswerPercent:  percentOf(stats.EmptyNoErrorCount(), total),
+
+		AuthoritativePercent:     percentOf(stats.AuthoritativeCount(), total),
+		AnswerTypeMatchedPercent: percentOf(stats.AnswerTypeMatchedCount(), total),
+		DNSSECValidatedPercent:   percentOf(stats.DNSSECValidatedCount(), total),
+		MeanAuthorityCount:       stats.MeanAuthorityCount(),
+		MeanAdditionalCount:      stats.MeanAdditionalCount(),
+	}
+}
+
+func percentOf(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
+
+func printJSONSummary(w io.Writer, summary Summary) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(summary)
+}
+
+// csvHeader is the -output csv column order: timestamp, name, type,
+// rcode, duration, error.
+var csvHeader = []string{"timestamp", "name", "type", "rcode", "duration_seconds", "error"}
+
+func writeCSVHeader(w *csv.Writer) error {
+	return w.Write(csvHeader)
+}
+
+func writeCSVRow(w *csv.Writer, r QueryResult) error {
+	errMsg := ""
+	if r.Err != nil {
+		errMsg = r.Err.Error()
+	}
+	return w.Write([]string{
+		r.Timestamp.Format(time.RFC3339Nano),
+		r.Name,
+		recordTypeName(r.Type),
+		r.RCode,
+		strconv.FormatFloat(r.Duration.Seconds(), 'f', -1, 64),
+		errMsg,
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+)
+
+// servePrometheusMetrics starts an HTTP server exposing dnsperf_* metrics
+// in the Prometheus text exposition format while a run is in progress.
+func servePrometheusMetrics(addr string, stats *Stats) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writePrometheusMetrics(w, stats)
+	})
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Error serving prometheus metrics on %s: %v", addr, err)
+		}
+	}()
+}
+
+func writePrometheusMetrics(w io.Writer, stats *Stats) {
+	fmt.Fprintln(w, "# HELP dnsperf_query_duration_seconds DNS query duration in seconds")
+	fmt.Fprintln(w, "# TYPE dnsperf_query_duration_seconds histogram")
+	var cumulative int64
+	for _, bucket := range stats.Latency.Buckets() {
+		cumulative += bucket.Count
+		le := float64(bucket.ToMicros) / 1e6
+		fmt.Fprintf(w, "dnsperf_query_duration_seconds_bucket{le=\"%g\"} %d\n", le, cumulative)
+	}
+	fmt.Fprintf(w, "dnsperf_query_duration_seconds_bucket{le=\"+Inf\"} %d\n", stats.Total())
+	fmt.Fprintf(w, "dnsperf_query_duration_seconds_sum %g\n", stats.LatencySumSeconds())
+	fmt.Fprintf(w, "dnsperf_query_duration_seconds_count %d\n", stats.Total())
+
+	fmt.Fprintln(w, "# HELP dnsperf_queries_total Total DNS queries issued, by response code")
+	fmt.Fprintln(w, "# TYPE dnsperf_queries_total counter")
+	for _, name := range sortedKeys(stats.RCodeCounts()) {
+		fmt.Fprintf(w, "dnsperf_queries_total{rcode=%q} %d\n", name, stats.RCodeCounts()[name])
+	}
+
+	fmt.Fprintln(w, "# HELP dnsperf_errors_total Total DNS query errors, by reason")
+	fmt.Fprintln(w, "# TYPE dnsperf_errors_total counter")
+	for _, name := range sortedKeys(stats.ErrorReasonCounts()) {
+		fmt.Fprintf(w, "dnsperf_errors_total{reason=%q} %d\n", name, stats.ErrorReasonCounts()[name])
+	}
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
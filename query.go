@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// QueryResult is the outcome of a single DNS query.
+type QueryResult struct {
+	Timestamp time.Time
+	Name      string
+	Type      uint16
+	// Duration is the service time: spent sending the query and waiting
+	// for the response (the handshake, if any, is reported separately).
+	Duration time.Duration
+	// ResponseDuration is the response time for -qps open-loop runs:
+	// scheduled->receive, including any queuing delay. Zero for
+	// closed-loop runs, where there's no queuing to measure.
+	ResponseDuration time.Duration
+	// HandshakeDuration is non-zero only for the query that immediately
+	// follows a fresh Dial, and records how long the transport took to
+	// set up its connection (TCP connect, TLS/QUIC handshake, ...).
+	HandshakeDuration time.Duration
+	Success           bool
+	// RCode is the DNS response code name (e.g. "NOERROR", "NXDOMAIN"),
+	// or "ERROR" when the query failed before a response was parsed.
+	RCode string
+	Err   error
+
+	Truncated         bool
+	Authoritative     bool
+	AnswerCount       int
+	AuthorityCount    int
+	AdditionalCount   int
+	AnswerTypeMatched bool
+	// DNSSECValidated reports whether an RRSIG was present to validate
+	// against; only meaningful when -dnssec was passed.
+	DNSSECValidated bool
+	// NSID is the server identifier returned in the OPT record; only set
+	// when -nsid was passed and the server supports it.
+	NSID string
+	// CookieEchoed reports whether the server echoed back a server cookie
+	// alongside our client cookie; only meaningful when -cookie was
+	// passed.
+	CookieEchoed bool
+}
+
+func buildQuery(domain string, recordType uint16, opts QueryOptions) ([]byte, error) {
+	m := new(dnsmessage.Message)
+	m.Header.ID = uint16(rand.Intn(65535))
+	m.Header.RecursionDesired = true
+	m.Questions = []dnsmessage.Question{
+		{
+			Name:  dnsmessage.MustNewName(domain + "."),
+			Type:  dnsmessage.Type(recordType),
+			Class: dnsmessage.ClassINET,
+		},
+	}
+	if opt, ok := buildOPT(opts); ok {
+		m.Additionals = append(m.Additionals, opt)
+	}
+	return m.Pack()
+}
+
+// performDNSQuery runs a single query over an already-dialed Conn.
+func performDNSQuery(ctx context.Context, conn Conn, domain string, recordType uint16, opts QueryOptions) QueryResult {
+	start := time.Now()
+	result := QueryResult{Timestamp: start, Name: domain, Type: recordType, RCode: "ERROR"}
+
+	packed, err := buildQuery(domain, recordType, opts)
+	if err != nil {
+		log.Printf("Error packing DNS message: %v", err)
+		result.Duration, result.Err = time.Since(start), err
+		return result
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := conn.Query(queryCtx, packed)
+	if err != nil {
+		log.Printf("Error performing DNS query: %v", err)
+		result.Duration, result.Err = time.Since(start), err
+		return result
+	}
+
+	var response dnsmessage.Message
+	if err := response.Unpack(resp); err != nil {
+		log.Printf("Error unpacking DNS response: %v", err)
+		result.Duration, result.Err = time.Since(start), err
+		return result
+	}
+
+	result.Duration = time.Since(start)
+	result.Success = true
+	classifyResponse(&result, &response, recordType, opts)
+	return result
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// QueryPlanEntry is one query to issue: a name and record type.
+type QueryPlanEntry struct {
+	Name string
+	Type uint16
+}
+
+// isQueryPlanSource reports whether -domain names a query plan (a local
+// file prefixed with '@', or an HTTP(S) URL) rather than a single literal
+// domain name.
+func isQueryPlanSource(domain string) bool {
+	return strings.HasPrefix(domain, "@") || strings.HasPrefix(domain, "http://") || strings.HasPrefix(domain, "https://")
+}
+
+// loadQueryPlan loads the set of names (and optional per-name types) to
+// query from a local file or URL. Each line is "NAME [TYPE]"; TYPE
+// defaults to defaultType when omitted. probability independently keeps
+// each line with that probability, so large plan files can be sampled
+// down without loading every name.
+func loadQueryPlan(source string, defaultType uint16, probability float64) ([]QueryPlanEntry, error) {
+	var r io.Reader
+	switch {
+	case strings.HasPrefix(source, "@"):
+		f, err := os.Open(strings.TrimPrefix(source, "@"))
+		if err != nil {
+			return nil, fmt.Errorf("opening query plan file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		resp, err := http.Get(source)
+		if err != nil {
+			return nil, fmt.Errorf("fetching query plan: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching query plan: server returned status %d", resp.StatusCode)
+		}
+		r = resp.Body
+	default:
+		return nil, fmt.Errorf("invalid query plan source %q (want @file or http(s):// URL)", source)
+	}
+
+	var plan []QueryPlanEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if probability < 1 && rand.Float64() > probability {
+			continue
+		}
+		fields := strings.Fields(line)
+		entry := QueryPlanEntry{Name: fields[0], Type: defaultType}
+		if len(fields) > 1 {
+			t, ok := recordTypeMap[strings.ToUpper(fields[1])]
+			if !ok {
+				return nil, fmt.Errorf("invalid record type %q on line %q", fields[1], line)
+			}
+			entry.Type = t
+		}
+		plan = append(plan, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading query plan: %w", err)
+	}
+	if len(plan) == 0 {
+		return nil, fmt.Errorf("query plan %q contained no usable entries", source)
+	}
+	return plan, nil
+}
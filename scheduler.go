@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Job is one query to run: which plan entry, and (for open-loop -qps runs)
+// when it was scheduled to fire, so the response time (scheduled->receive)
+// can be reported alongside the service time (send->receive).
+type Job struct {
+	PlanIndex   int
+	ScheduledAt time.Time
+}
+
+func nextPlanIndex(randomize bool, planLen int, queryCount *int64) int {
+	if randomize {
+		return rand.Intn(planLen)
+	}
+	return int(atomic.LoadInt64(queryCount)) % planLen
+}
+
+// runClosedLoopDispatcher is today's default: a worker only gets its next
+// job once it's asked for one, so throughput is naturally capped by
+// however fast the server (and workers) can keep up.
+func runClosedLoopDispatcher(ctx context.Context, jobs chan<- Job, planLen int, randomize bool, maxQueries int64, queryCount *int64, progress func(int64)) {
+	for maxQueries == -1 || atomic.LoadInt64(queryCount) < maxQueries {
+		select {
+		case <-ctx.Done():
+			return
+		case jobs <- Job{PlanIndex: nextPlanIndex(randomize, planLen, queryCount)}:
+			count := atomic.AddInt64(queryCount, 1)
+			progress(count)
+		}
+	}
+	close(jobs)
+}
+
+// runOpenLoopScheduler emits jobs on a fixed-rate ticker regardless of how
+// many are still in flight, so server-side slowdowns show up as queuing
+// delay (ResponseDuration) rather than silently throttling the send rate -
+// the "coordinated omission" problem with closed-loop generators.
+// Jobs that can't fit in the bounded queue (maxInflight) are dropped and
+// counted in stats, since a real load generator can't block waiting on
+// the server.
+func runOpenLoopScheduler(ctx context.Context, jobs chan Job, planLen int, randomize bool, maxQueries int64, queryCount *int64, qps float64, stats *Stats, progress func(int64)) {
+	interval := time.Duration(float64(time.Second) / qps)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(jobs)
+
+	for maxQueries == -1 || atomic.LoadInt64(queryCount) < maxQueries {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job := Job{PlanIndex: nextPlanIndex(randomize, planLen, queryCount), ScheduledAt: time.Now()}
+			select {
+			case jobs <- job:
+				count := atomic.AddInt64(queryCount, 1)
+				progress(count)
+			default:
+				dropped := stats.RecordDropped()
+				if dropped%100 == 1 {
+					log.Printf("Dropping scheduled query: %d in flight already (raise -max-inflight to avoid this)", cap(jobs))
+				}
+			}
+		}
+	}
+}
+
+func validateQPSFlags(qps float64, maxInflight int) error {
+	if qps < 0 {
+		return fmt.Errorf("-qps must be >= 0")
+	}
+	if qps > 0 && maxInflight <= 0 {
+		return fmt.Errorf("-max-inflight must be > 0 when -qps is set")
+	}
+	if qps > 0 && time.Duration(float64(time.Second)/qps) < 1 {
+		return fmt.Errorf("-qps must be <= %d (one query per nanosecond, the ticker's finest resolution)", int64(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats aggregates query results for the final summary, -output json/csv
+// and the optional -prometheus live exporter.
+type Stats struct {
+	Latency *LatencyRecorder
+	// ResponseLatency tracks scheduled->receive time for -qps open-loop
+	// runs; it stays empty for closed-loop runs.
+	ResponseLatency *LatencyRecorder
+
+	total, success int64
+
+	totalLatency   int64 // nanoseconds, atomic; for the Prometheus histogram's _sum series
+	totalHandshake int64 // nanoseconds, atomic
+	handshakeCount int64
+	responseCount  int64
+
+	truncated         int64
+	emptyNoErrorCount int64
+	cookieEchoed      int64
+	dropped           int64 // -qps jobs that didn't fit in -max-inflight
+
+	authoritative     int64
+	answerTypeMatched int64
+	dnssecValidated   int64 // only meaningful when -dnssec was passed
+	totalAuthorities  int64
+	totalAdditionals  int64
+
+	mu      sync.Mutex
+	rcodes  map[string]int64
+	reasons map[string]int64
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		Latency:         NewLatencyRecorder(),
+		ResponseLatency: NewLatencyRecorder(),
+		rcodes:          make(map[string]int64),
+		reasons:         make(map[string]int64),
+	}
+}
+
+func (s *Stats) Record(r QueryResult) {
+	atomic.AddInt64(&s.total, 1)
+	if r.Success {
+		atomic.AddInt64(&s.success, 1)
+	}
+	if r.HandshakeDuration > 0 {
+		atomic.AddInt64(&s.totalHandshake, int64(r.HandshakeDuration))
+		atomic.AddInt64(&s.handshakeCount, 1)
+	}
+	s.Latency.Record(r.Duration)
+	atomic.AddInt64(&s.totalLatency, int64(r.Duration))
+	if r.ResponseDuration > 0 {
+		s.ResponseLatency.Record(r.ResponseDuration)
+		atomic.AddInt64(&s.responseCount, 1)
+	}
+	if r.Truncated {
+		atomic.AddInt64(&s.truncated, 1)
+	}
+	if r.RCode == "NOERROR" && r.AnswerCount == 0 {
+		atomic.AddInt64(&s.emptyNoErrorCount, 1)
+	}
+	if r.CookieEchoed {
+		atomic.AddInt64(&s.cookieEchoed, 1)
+	}
+	if r.Authoritative {
+		atomic.AddInt64(&s.authoritative, 1)
+	}
+	if r.AnswerTypeMatched {
+		atomic.AddInt64(&s.answerTypeMatched, 1)
+	}
+	if r.DNSSECValidated {
+		atomic.AddInt64(&s.dnssecValidated, 1)
+	}
+	atomic.AddInt64(&s.totalAuthorities, int64(r.AuthorityCount))
+	atomic.AddInt64(&s.totalAdditionals, int64(r.AdditionalCount))
+
+	s.mu.Lock()
+	s.rcodes[r.RCode]++
+	if r.Err != nil {
+		s.reasons[errorReason(r.Err)]++
+	}
+	s.mu.Unlock()
+}
+
+func (s *Stats) Total() int64   { return atomic.LoadInt64(&s.total) }
+func (s *Stats) Success() int64 { return atomic.LoadInt64(&s.success) }
+
+// HasResponseLatency reports whether this was an open-loop (-qps) run, so
+// summaries know whether to report response time alongside service time.
+func (s *Stats) HasResponseLatency() bool { return atomic.LoadInt64(&s.responseCount) > 0 }
+
+// LatencySumSeconds is the sum of every recorded query duration, in
+// seconds, for the Prometheus histogram's required _sum series.
+func (s *Stats) LatencySumSeconds() float64 {
+	return time.Duration(atomic.LoadInt64(&s.totalLatency)).Seconds()
+}
+
+// TruncatedCount is how many responses had the TC bit set.
+func (s *Stats) TruncatedCount() int64 { return atomic.LoadInt64(&s.truncated) }
+
+// EmptyNoErrorCount is how many NOERROR responses had no answers.
+func (s *Stats) EmptyNoErrorCount() int64 { return atomic.LoadInt64(&s.emptyNoErrorCount) }
+
+// CookieEchoedCount is how many responses echoed back a server cookie;
+// only meaningful when -cookie was passed.
+func (s *Stats) CookieEchoedCount() int64 { return atomic.LoadInt64(&s.cookieEchoed) }
+
+// RecordDropped counts a -qps scheduled query that didn't fit in the
+// -max-inflight bounded queue and was dropped rather than sent.
+func (s *Stats) RecordDropped() int64 { return atomic.AddInt64(&s.dropped, 1) }
+
+// DroppedCount is how many scheduled queries were dropped because
+// -max-inflight was full; only meaningful for -qps open-loop runs.
+func (s *Stats) DroppedCount() int64 { return atomic.LoadInt64(&s.dropped) }
+
+// AuthoritativeCount is how many responses had the AA bit set.
+func (s *Stats) AuthoritativeCount() int64 { return atomic.LoadInt64(&s.authoritative) }
+
+// AnswerTypeMatchedCount is how many responses actually contained the
+// requested record type in their answer section.
+func (s *Stats) AnswerTypeMatchedCount() int64 { return atomic.LoadInt64(&s.answerTypeMatched) }
+
+// DNSSECValidatedCount is how many responses carried an RRSIG; only
+// meaningful when -dnssec was passed.
+func (s *Stats) DNSSECValidatedCount() int64 { return atomic.LoadInt64(&s.dnssecValidated) }
+
+// MeanAuthorityCount is the average number of authority-section records
+// per response.
+func (s *Stats) MeanAuthorityCount() float64 {
+	total := s.Total()
+	if total == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&s.totalAuthorities)) / float64(total)
+}
+
+// MeanAdditionalCount is the average number of additional-section records
+// per response.
+func (s *Stats) MeanAdditionalCount() float64 {
+	total := s.Total()
+	if total == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&s.totalAdditionals)) / float64(total)
+}
+
+// Handshakes returns the average handshake duration and how many
+// connections it was measured over.
+func (s *Stats) Handshakes() (time.Duration, int64) {
+	count := atomic.LoadInt64(&s.handshakeCount)
+	if count == 0 {
+		return 0, 0
+	}
+	return time.Duration(atomic.LoadInt64(&s.totalHandshake) / count), count
+}
+
+func (s *Stats) RCodeCounts() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]int64, len(s.rcodes))
+	for k, v := range s.rcodes {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *Stats) ErrorReasonCounts() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]int64, len(s.reasons))
+	for k, v := range s.reasons {
+		out[k] = v
+	}
+	return out
+}
+
+// errorReason buckets an error into a short, stable label suitable for a
+// metric tag.
+func errorReason(err error) string {
+	if err == nil {
+		return "none"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	if strings.Contains(err.Error(), "connection refused") {
+		return "connection_refused"
+	}
+	return "other"
+}
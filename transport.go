@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Conn is a single underlying connection (or session) to a DNS server for
+// one transport. Implementations may be reused across many queries.
+type Conn interface {
+	// Query sends a packed DNS message and returns the packed response.
+	Query(ctx context.Context, msg []byte) ([]byte, error)
+	Close() error
+}
+
+// Transport dials the underlying connection for a protocol. Dial is
+// expected to be called once per worker (or once total, when connections
+// are shared) and the returned Conn reused for subsequent queries so that
+// query latency doesn't include socket/handshake setup.
+type Transport interface {
+	// Name is the protocol name as accepted by -protocol.
+	Name() string
+	// Dial establishes the connection and reports how long the
+	// handshake (TCP connect, TLS handshake, QUIC handshake, ...) took.
+	Dial(ctx context.Context) (Conn, time.Duration, error)
+}
+
+// TransportConfig carries the flags relevant to transport construction.
+type TransportConfig struct {
+	Server     string
+	ServerName string
+	Insecure   bool
+	BufSize    int
+}
+
+// NewTransport builds the Transport for the given protocol name.
+func NewTransport(protocol string, cfg TransportConfig) (Transport, error) {
+	switch protocol {
+	case "udp", "":
+		return &udpTransport{server: cfg.Server, bufSize: cfg.BufSize}, nil
+	case "tcp":
+		return &tcpTransport{server: cfg.Server}, nil
+	case "tls":
+		return &tlsTransport{server: cfg.Server, serverName: cfg.ServerName, insecure: cfg.Insecure}, nil
+	case "https":
+		return &httpsTransport{server: cfg.Server, serverName: cfg.ServerName, insecure: cfg.Insecure}, nil
+	case "quic":
+		return &quicTransport{server: cfg.Server, serverName: cfg.ServerName, insecure: cfg.Insecure}, nil
+	default:
+		return nil, fmt.Errorf("unknown protocol %q (want udp, tcp, tls, https or quic)", protocol)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// httpsTransport implements DNS-over-HTTPS (RFC 8484): a POST of the raw
+// DNS message to /dns-query with content type application/dns-message.
+type httpsTransport struct {
+	server     string
+	serverName string
+	insecure   bool
+}
+
+func (t *httpsTransport) Name() string { return "https" }
+
+func (t *httpsTransport) Dial(ctx context.Context) (Conn, time.Duration, error) {
+	serverName := t.serverName
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(t.server)
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				ServerName:         serverName,
+				InsecureSkipVerify: t.insecure,
+			},
+		},
+		Timeout: 5 * time.Second,
+	}
+	url := fmt.Sprintf("https://%s/dns-query", t.server)
+	c := &httpsConn{client: client, url: url}
+
+	// There's no separate handshake step with net/http - the TLS
+	// handshake happens lazily on the first request - so time it by
+	// issuing a throwaway request and tracing the handshake via
+	// httptrace, then discard the response.
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	var handshakeStart, handshakeDone time.Time
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeStart: func() { handshakeStart = time.Now() },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { handshakeDone = time.Now() },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, time.Since(start), err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	handshake := time.Since(start)
+	if !handshakeStart.IsZero() && !handshakeDone.IsZero() {
+		handshake = handshakeDone.Sub(handshakeStart)
+	}
+	return c, handshake, nil
+}
+
+type httpsConn struct {
+	client *http.Client
+	url    string
+}
+
+func (c *httpsConn) Query(ctx context.Context, msg []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh server returned status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (c *httpsConn) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
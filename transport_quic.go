@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// doqALPN is the ALPN token for DNS-over-QUIC (RFC 9250).
+const doqALPN = "doq"
+
+// quicTransport implements DNS-over-QUIC (RFC 9250): each query is sent on
+// its own bidirectional stream of a shared QUIC connection, length-prefixed
+// exactly like DNS-over-TCP.
+type quicTransport struct {
+	server     string
+	serverName string
+	insecure   bool
+}
+
+func (t *quicTransport) Name() string { return "quic" }
+
+func (t *quicTransport) Dial(ctx context.Context) (Conn, time.Duration, error) {
+	start := time.Now()
+	serverName := t.serverName
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(t.server)
+	}
+	tlsConf := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: t.insecure,
+		NextProtos:         []string{doqALPN},
+	}
+	session, err := quic.DialAddr(ctx, t.server, tlsConf, nil)
+	if err != nil {
+		return nil, time.Since(start), err
+	}
+	return &quicConn{session: session}, time.Since(start), nil
+}
+
+type quicConn struct {
+	session quic.Connection
+}
+
+func (c *quicConn) Query(ctx context.Context, msg []byte) ([]byte, error) {
+	stream, err := c.session.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	if err := writeLengthPrefixed(stream, msg); err != nil {
+		return nil, err
+	}
+	// The client must signal it has no more data on this stream so the
+	// server knows the query is complete.
+	stream.Close()
+
+	return readLengthPrefixed(stream)
+}
+
+func (c *quicConn) Close() error {
+	return c.session.CloseWithError(0, "")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// tcpTransport implements plain DNS-over-TCP (RFC 7766): every message is
+// prefixed with a 2-byte big-endian length.
+type tcpTransport struct {
+	server string
+}
+
+func (t *tcpTransport) Name() string { return "tcp" }
+
+func (t *tcpTransport) Dial(ctx context.Context) (Conn, time.Duration, error) {
+	start := time.Now()
+	conn, err := net.Dial("tcp", t.server)
+	if err != nil {
+		return nil, time.Since(start), err
+	}
+	return &streamConn{conn: conn}, time.Since(start), nil
+}
+
+// streamConn sends length-prefixed DNS messages over a stream, shared by
+// the tcp and tls (DoT) transports.
+type streamConn struct {
+	conn net.Conn
+
+	// sendMu serializes send(), since a demuxConn lets many goroutines
+	// call it concurrently on a shared connection; without it, two
+	// length+body writes can interleave and corrupt the framing.
+	sendMu sync.Mutex
+}
+
+func writeLengthPrefixed(w io.Writer, msg []byte) error {
+	var lenBuf [2]byte
+	binary.BigEndian.PutUint16(lenBuf[:], uint16(len(msg)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+func readLengthPrefixed(r io.Reader) ([]byte, error) {
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint16(lenBuf[:])
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (c *streamConn) Query(ctx context.Context, msg []byte) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+	} else {
+		c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+	if err := c.send(msg); err != nil {
+		return nil, err
+	}
+	return c.recv()
+}
+
+func (c *streamConn) send(msg []byte) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if err := writeLengthPrefixed(c.conn, msg); err != nil {
+		return fmt.Errorf("writing query: %w", err)
+	}
+	return nil
+}
+
+func (c *streamConn) recv() ([]byte, error) {
+	// Bounds every recv() call, including ones made by a demuxConn's
+	// reader goroutine (which never goes through Query and so never gets
+	// a deadline from the caller's context) - see demuxReadTimeout.
+	c.conn.SetReadDeadline(time.Now().Add(demuxReadTimeout))
+	resp, err := readLengthPrefixed(c.conn)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	return resp, nil
+}
+
+func (c *streamConn) Close() error { return c.conn.Close() }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// tlsTransport implements DNS-over-TLS (RFC 7858): the same length-prefixed
+// framing as DNS-over-TCP, over a TLS session on port 853.
+type tlsTransport struct {
+	server     string
+	serverName string
+	insecure   bool
+}
+
+func (t *tlsTransport) Name() string { return "tls" }
+
+func (t *tlsTransport) Dial(ctx context.Context) (Conn, time.Duration, error) {
+	start := time.Now()
+	serverName := t.serverName
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(t.server)
+	}
+	dialer := &net.Dialer{}
+	conn, err := tls.DialWithDialer(dialer, "tcp", t.server, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: t.insecure,
+	})
+	if err != nil {
+		return nil, time.Since(start), err
+	}
+	return &streamConn{conn: conn}, time.Since(start), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// minUDPReadBuffer is the floor for udpConn's read buffer regardless of
+// -bufsize, so responses from servers that ignore the advertised payload
+// size (or that echo a larger one) still aren't truncated by us.
+const minUDPReadBuffer = 4096
+
+// demuxReadTimeout bounds every recv() call, including ones made by a
+// demuxConn's reader goroutine (which never goes through Query and so
+// never gets a deadline from the caller's context). Without this, one
+// dropped UDP response wedges the reader forever and starves every other
+// query sharing the connection.
+const demuxReadTimeout = 2 * time.Second
+
+// udpTransport implements plain DNS-over-UDP. There is no handshake, so
+// Dial just opens the socket.
+type udpTransport struct {
+	server  string
+	bufSize int
+}
+
+func (t *udpTransport) Name() string { return "udp" }
+
+func (t *udpTransport) Dial(ctx context.Context) (Conn, time.Duration, error) {
+	start := time.Now()
+	conn, err := net.Dial("udp", t.server)
+	if err != nil {
+		return nil, time.Since(start), err
+	}
+	readBuf := t.bufSize
+	if readBuf < minUDPReadBuffer {
+		readBuf = minUDPReadBuffer
+	}
+	return &udpConn{conn: conn, readBuf: readBuf}, time.Since(start), nil
+}
+
+type udpConn struct {
+	conn    net.Conn
+	readBuf int
+}
+
+func (c *udpConn) Query(ctx context.Context, msg []byte) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+	} else {
+		c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+	if err := c.send(msg); err != nil {
+		return nil, err
+	}
+	return c.recv()
+}
+
+func (c *udpConn) send(msg []byte) error {
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+func (c *udpConn) recv() ([]byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(demuxReadTimeout))
+	resp := make([]byte, c.readBuf)
+	n, err := c.conn.Read(resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp[:n], nil
+}
+
+func (c *udpConn) Close() error { return c.conn.Close() }
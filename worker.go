@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// worker reuses a single connection for every job it pulls, so query
+// latency doesn't include per-query socket setup. If shared is non-nil,
+// the worker queries it directly instead of dialing its own (see
+// -separate-worker-connections in main.go).
+func worker(ctx context.Context, transport Transport, shared Conn, plan []QueryPlanEntry, opts QueryOptions, jobs <-chan Job, results chan<- QueryResult, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	conn := shared
+	var handshake time.Duration
+	if conn == nil {
+		var err error
+		var rawConn Conn
+		rawConn, handshake, err = transport.Dial(ctx)
+		if err != nil {
+			log.Printf("Error dialing %s transport: %v", transport.Name(), err)
+			return
+		}
+		defer rawConn.Close()
+		conn = rawConn
+	}
+
+	first := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job, ok := <-jobs:
+			if !ok {
+				return
+			}
+			entry := plan[job.PlanIndex]
+			result := performDNSQuery(ctx, conn, entry.Name, entry.Type, opts)
+			if !job.ScheduledAt.IsZero() {
+				result.ResponseDuration = time.Since(job.ScheduledAt)
+			}
+			if first {
+				result.HandshakeDuration = handshake
+				first = false
+			}
+			results <- result
+		}
+	}
+}